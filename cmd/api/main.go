@@ -2,26 +2,99 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"webhook-delivery/internal/delivery"
+	"webhook-delivery/internal/dlq"
 	"webhook-delivery/internal/platform"
 	"webhook-delivery/internal/queue"
 	"webhook-delivery/internal/ratelimit"
+
+	"github.com/redis/go-redis/v9"
 )
 
+// idempotencyTTL bounds how long an idempotency key dedupes submissions
+// for, after which a legitimate re-submission is treated as a new task.
+const idempotencyTTL = 24 * time.Hour
+
+// maxDeadLetterSize caps the dead letter queue; past it, the oldest
+// entries are evicted first to make room for newly-dead tasks.
+const maxDeadLetterSize = 10000
+
+// defaultDLQPageSize is used when a /dlq list request doesn't specify limit.
+const defaultDLQPageSize = 50
+
+// Default parameters for whichever rate limit strategy is selected.
+const (
+	rateLimitRequests    = 5
+	rateLimitWindow      = 60 * time.Second
+	rateLimitBucketBurst = rateLimitRequests
+)
+
+// rateLimitBucketRate is derived from the two constants above, so it can't
+// live in the const block itself (time.Duration.Seconds() isn't a constant
+// expression).
+var rateLimitBucketRate = float64(rateLimitRequests) / rateLimitWindow.Seconds()
+
+// newLimiter builds the Limiter selected by RATE_LIMIT_STRATEGY
+// (fixed|sliding|token_bucket; fixed is the default).
+func newLimiter(rdb *redis.Client) ratelimit.Limiter {
+	switch os.Getenv("RATE_LIMIT_STRATEGY") {
+	case "sliding":
+		return ratelimit.NewSlidingWindowLimiter(rdb, rateLimitRequests, rateLimitWindow)
+	case "token_bucket":
+		return ratelimit.NewTokenBucketLimiter(rdb, rateLimitBucketRate, rateLimitBucketBurst)
+	default:
+		return ratelimit.NewFixedWindowLimiter(rdb, rateLimitRequests, rateLimitWindow)
+	}
+}
+
+// setRateLimitHeaders surfaces a rate limit Decision as the standard
+// X-RateLimit-* / Retry-After headers. A negative Limit (NoOpLimiter) means
+// no cap is enforced, so there's nothing to report.
+func setRateLimitHeaders(w http.ResponseWriter, decision ratelimit.Decision) {
+	if decision.Limit < 0 {
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	if !decision.Allowed {
+		retryAfterSeconds := int(decision.RetryAfter.Round(time.Second).Seconds())
+		if retryAfterSeconds < 1 {
+			retryAfterSeconds = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+}
+
 // 1. Request DTO (Data Transfer Object)
 type WebhookRequest struct {
-	UserID string          `json:"user_id"`
-	Data   json.RawMessage `json:"data,omitempty"`
+	UserID         string            `json:"user_id"`
+	TargetURL      string            `json:"target_url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	Queue          string            `json:"queue,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	Data           json.RawMessage   `json:"data,omitempty"`
 }
 
 // 2. Response DTO
 type APIResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
+	TaskID  string `json:"task_id,omitempty"`
+}
+
+// DLQListResponse is the paginated response for GET /dlq.
+type DLQListResponse struct {
+	Entries    []dlq.Entry `json:"entries"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 func main() {
@@ -33,13 +106,17 @@ func main() {
 	fmt.Println("🔌 Producer Connected to Valkey")
 
 	// B. Services (Dependency Injection)
-	// Strategy Pattern (FixedWindowLimiter).
-	limiter := ratelimit.NewFixedWindowLimiter(rdb, 5, 60*time.Second)
-	// limiter = ratelimit.NewNoOpLimiter()
+	// Strategy Pattern: which rate limit algorithm we run is chosen at
+	// startup via RATE_LIMIT_STRATEGY, all behind the same Limiter contract.
+	limiter := newLimiter(rdb)
 
 	// Adapter Pattern: Connecting Redis to our generic Queue interface.
 	var queueSvc queue.Queue = queue.NewRedisQueue(rdb)
 
+	// Dead letter queue: terminally-failed tasks land here for operator
+	// inspection and manual requeue instead of being dropped silently.
+	deadLetter := dlq.NewStore(rdb, maxDeadLetterSize)
+
 	// C. The Handler Wrapper
 	http.HandleFunc("/send", func(w http.ResponseWriter, r *http.Request) {
 		// STEP 1: Method Validation (REST Compliance)
@@ -60,18 +137,31 @@ func main() {
 			http.Error(w, "Field 'user_id' is required", http.StatusBadRequest)
 			return
 		}
+		if req.TargetURL == "" {
+			http.Error(w, "Field 'target_url' is required", http.StatusBadRequest)
+			return
+		}
+		if err := delivery.ValidateTargetURL(req.TargetURL); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid 'target_url': %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Queue != "" && !queue.IsKnownQueue(req.Queue) {
+			http.Error(w, fmt.Sprintf("Unknown 'queue' %q", req.Queue), http.StatusBadRequest)
+			return
+		}
 
 		// STEP 3: Rate Limiting (The "Doorman")
 		// We use the Context from the request so if the user cancels
 		// the request (closes tab), we stop processing.
-		allowed, err := limiter.Allow(r.Context(), req.UserID)
+		decision, err := limiter.Allow(r.Context(), req.UserID)
 		if err != nil {
 			// Log the error internally, but show generic 500 to user (Security)
 			log.Printf("Rate limit error: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		if !allowed {
+		setRateLimitHeaders(w, decision)
+		if !decision.Allowed {
 			// We return 429 Too Many Requests (Standard Code)
 			http.Error(w, "Rate limit exceeded. Try again later.", http.StatusTooManyRequests)
 			return
@@ -81,25 +171,68 @@ func main() {
 		// We treat the 'Data' they sent as the payload.
 		// We convert the raw bytes back to string for storage.
 		newTask := queue.Task{
+			UserID:     req.UserID,
 			Payload:    string(req.Data),
+			TargetURL:  req.TargetURL,
+			Headers:    req.Headers,
 			RetryCount: 0,
 		}
 
-		if err := queueSvc.Enqueue(r.Context(), newTask); err != nil {
+		// UniqueEnqueue is a no-op-if-duplicate Enqueue: with no
+		// IdempotencyKey it behaves exactly like Enqueue.
+		taskID, err := queueSvc.UniqueEnqueue(r.Context(), req.Queue, newTask, req.IdempotencyKey, idempotencyTTL)
+		if err != nil && !errors.Is(err, queue.ErrDuplicateTask) {
 			log.Printf("Queue error: %v", err)
 			http.Error(w, "Failed to accept task", http.StatusInternalServerError)
 			return
 		}
 
-		// STEP 5: Success Response
+		// STEP 5: Response
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted) // 202 Accepted (Standard for async jobs)
 
-		response := APIResponse{
+		if errors.Is(err, queue.ErrDuplicateTask) {
+			// Same idempotency key as an in-flight/recent task: tell the
+			// caller about the original instead of queuing a duplicate.
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(APIResponse{
+				Status:  "duplicate",
+				Message: "Request already accepted; returning the original task.",
+				TaskID:  taskID,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted) // 202 Accepted (Standard for async jobs)
+		json.NewEncoder(w).Encode(APIResponse{
 			Status:  "success",
 			Message: "Request accepted and queued for delivery.",
+			TaskID:  taskID,
+		})
+	})
+
+	// D. Dead Letter Queue Admin API
+	http.HandleFunc("/dlq", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed. Use GET.", http.StatusMethodNotAllowed)
+			return
+		}
+		handleDLQList(w, r, deadLetter)
+	})
+	http.HandleFunc("/dlq/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/dlq/"), "/requeue")
+		if id == "" {
+			http.Error(w, "Task id is required", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/requeue"):
+			handleDLQRequeue(w, r, deadLetter, queueSvc, limiter, id)
+		case r.Method == http.MethodDelete:
+			handleDLQDelete(w, r, deadLetter, id)
+		default:
+			http.Error(w, "Method not allowed.", http.StatusMethodNotAllowed)
 		}
-		json.NewEncoder(w).Encode(response)
 	})
 
 	log.Println("🚀 API Server running on port 8080")
@@ -111,3 +244,106 @@ func main() {
 	}
 	log.Fatal(server.ListenAndServe())
 }
+
+// handleDLQList serves GET /dlq?limit=&cursor=, a paginated, newest-first
+// view of terminally-failed tasks for operator inspection.
+func handleDLQList(w http.ResponseWriter, r *http.Request, store *dlq.Store) {
+	limit := defaultDLQPageSize
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid 'limit' query param", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, nextCursor, err := store.List(r.Context(), limit, r.URL.Query().Get("cursor"))
+	if err != nil {
+		log.Printf("DLQ list error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DLQListResponse{Entries: entries, NextCursor: nextCursor})
+}
+
+// handleDLQRequeue serves POST /dlq/{id}/requeue: it re-submits the dead
+// task through the same rate limiter a fresh request would go through,
+// marks where it came from, and removes it from the dead letter queue on
+// success so it isn't requeued twice.
+func handleDLQRequeue(w http.ResponseWriter, r *http.Request, store *dlq.Store, queueSvc queue.Queue, limiter ratelimit.Limiter, id string) {
+	entry, err := store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			http.Error(w, "No such dead letter entry", http.StatusNotFound)
+			return
+		}
+		log.Printf("DLQ get error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	decision, err := limiter.Allow(r.Context(), entry.Task.UserID)
+	if err != nil {
+		log.Printf("Rate limit error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	setRateLimitHeaders(w, decision)
+	if !decision.Allowed {
+		http.Error(w, "Rate limit exceeded. Try again later.", http.StatusTooManyRequests)
+		return
+	}
+
+	task := entry.Task
+	task.ID = ""
+	task.RetryCount = 0
+	task.Origin = "dlq-requeue"
+	task.IdempotencyKey = ""
+
+	// No idempotency key here: this is an operator-initiated requeue, not a
+	// client submission, so UniqueEnqueue just behaves like Enqueue while
+	// still handing back the newly assigned task ID.
+	taskID, err := queueSvc.UniqueEnqueue(r.Context(), task.Queue, task, "", 0)
+	if err != nil {
+		log.Printf("Queue error: %v", err)
+		http.Error(w, "Failed to requeue task", http.StatusInternalServerError)
+		return
+	}
+
+	if err := store.Delete(r.Context(), id); err != nil {
+		log.Printf("DLQ delete error after requeue: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: "Task requeued for delivery.",
+		TaskID:  taskID,
+	})
+}
+
+// handleDLQDelete serves DELETE /dlq/{id}: permanently discards a dead
+// letter entry without requeuing it.
+func handleDLQDelete(w http.ResponseWriter, r *http.Request, store *dlq.Store, id string) {
+	if _, err := store.Get(r.Context(), id); err != nil {
+		if errors.Is(err, redis.Nil) {
+			http.Error(w, "No such dead letter entry", http.StatusNotFound)
+			return
+		}
+		log.Printf("DLQ get error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := store.Delete(r.Context(), id); err != nil {
+		log.Printf("DLQ delete error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -13,13 +12,49 @@ import (
 	"time"
 
 	"webhook-delivery/internal/backoff"
+	"webhook-delivery/internal/delivery"
+	"webhook-delivery/internal/dlq"
 	"webhook-delivery/internal/platform"
 	"webhook-delivery/internal/queue"
+	"webhook-delivery/internal/scheduler"
 	"webhook-delivery/internal/worker"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// maxDeadLetterSize caps the dead letter queue; past it, the oldest
+// entries are evicted first to make room for newly-dead tasks.
+const maxDeadLetterSize = 10000
+
+// Default parameters for whichever backoff strategy is selected.
+const (
+	backoffBase = 1 * time.Second
+	backoffMax  = 1 * time.Hour
+)
+
+// newBackoffStrategy builds the Strategy selected by strategyName
+// (exp|full_jitter|decorrelated; exp is the default).
+func newBackoffStrategy(strategyName string) backoff.Strategy {
+	switch strategyName {
+	case "full_jitter":
+		return backoff.NewFullJitterStrategy(backoffBase, backoffMax)
+	case "decorrelated":
+		return backoff.NewDecorrelatedJitterStrategy(backoffBase, backoffMax)
+	default:
+		return backoff.NewExponentialStrategy(backoffBase, 2.0, backoffMax)
+	}
+}
+
+// The named queues workers poll, in strict-priority order, with the
+// weights used in weighted-priority mode.
+var queueWeights = []queue.QueueWeight{
+	{Name: queue.QueueCritical, Weight: 6},
+	{Name: queue.QueueDefault, Weight: 3},
+	{Name: queue.QueueLow, Weight: 1},
+}
+
+var strictQueueOrder = []string{queue.QueueCritical, queue.QueueDefault, queue.QueueLow}
+
 func main() {
 	// 1. Infrastructure
 	rdb, err := platform.GetRedisClient()
@@ -31,14 +66,31 @@ func main() {
 	// 2. Setup Dependencies
 	queueSvc := queue.NewRedisQueue(rdb)
 
-	// Strategy Pattern: We choose Exponential Backoff
-	retryStrategy := backoff.NewExponentialStrategy(1*time.Second, 2.0, 1*time.Hour)
+	// Strategy Pattern: which backoff algorithm we use is chosen at
+	// startup via BACKOFF_STRATEGY, all behind the same Strategy contract.
+	retryStrategy := newBackoffStrategy(os.Getenv("BACKOFF_STRATEGY"))
+
+	// Delivery: real HTTP calls, signed, with a small pool of goroutines
+	// and a circuit breaker per destination host.
+	deliveryClient := delivery.NewClient(10*time.Second, os.Getenv("WEBHOOK_SIGNING_SECRET"))
+	breaker := delivery.NewCircuitBreaker(5, 30*time.Second)
+	dispatcher := delivery.NewDispatcher(breaker)
 
-	processor := worker.NewProcessor(rdb, queueSvc, retryStrategy)
+	deadLetter := dlq.NewStore(rdb, maxDeadLetterSize)
 
-	// 3. Start the "Scheduler" (The Retry Poller)
-	// This runs in the background and checks for tasks that are ready to be retried.
-	go startRetryPoller(rdb, queueSvc)
+	processor := worker.NewProcessor(rdb, queueSvc, retryStrategy, deliveryClient, breaker, dispatcher, deadLetter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// 3. Start the Scheduler (retry poller + lease recovery)
+	// This runs in the background and atomically moves due retries and
+	// abandoned (lease-expired) tasks back onto the main queue.
+	sched := scheduler.New(rdb)
+	go sched.Run(ctx, 1*time.Second)
+
+	// Reclaim per-host delivery pools that have gone quiet, so a stream of
+	// one-off target_urls doesn't leak 3 goroutines apiece forever.
+	go dispatcher.Run(ctx, 1*time.Minute)
 
 	// 4. Start Worker Pool (Scalability)
 	// We start 5 workers. They will all consume from the SAME queue concurrently.
@@ -46,14 +98,21 @@ func main() {
 	numWorkers := 5
 	var wg sync.WaitGroup
 
-	ctx, cancel := context.WithCancel(context.Background())
+	// Strict mode always polls critical, then default, then low. Weighted
+	// mode reshuffles that order (proportionally to weight) on every poll
+	// so default/low still make progress instead of starving behind a
+	// never-ending stream of critical tasks.
+	queueMode := os.Getenv("QUEUE_MODE")
+	if queueMode == "" {
+		queueMode = "weighted"
+	}
 
-	fmt.Printf("🚀 Starting %d Workers...\n", numWorkers)
+	fmt.Printf("🚀 Starting %d Workers (queue mode: %s)...\n", numWorkers, queueMode)
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			startConsumer(ctx, workerID, queueSvc, processor)
+			startConsumer(ctx, workerID, queueSvc, processor, queueMode)
 		}(i)
 	}
 
@@ -70,7 +129,7 @@ func main() {
 }
 
 // startConsumer is the infinite loop for each worker
-func startConsumer(ctx context.Context, id int, q queue.Queue, p *worker.Processor) {
+func startConsumer(ctx context.Context, id int, q queue.Queue, p *worker.Processor, queueMode string) {
 	fmt.Printf("Worker %d started\n", id)
 	for {
 		// Check for shutdown signal BEFORE asking for work
@@ -87,7 +146,7 @@ func startConsumer(ctx context.Context, id int, q queue.Queue, p *worker.Process
 		// For this project, we assume Dequeue blocks but handles context cancellation if you implemented it.
 		// Since our Dequeue uses 0 (infinite wait), this will block until a task arrives.
 		// FIX: Heartbeat Dequeue (Waits max 1 second) (queue updated as shutting down was getting blocked)
-		task, err := q.Dequeue(ctx)
+		task, _, err := q.Dequeue(ctx, pollOrder(queueMode)...)
 		if err != nil {
 			// A. Context Canceled (Ctrl+C during the 1s wait)
 			if errors.Is(err, context.Canceled) {
@@ -112,41 +171,12 @@ func startConsumer(ctx context.Context, id int, q queue.Queue, p *worker.Process
 	}
 }
 
-// startRetryPoller checks the ZSET for tasks that are ready to run
-func startRetryPoller(rdb *redis.Client, q queue.Queue) {
-	ticker := time.NewTicker(1 * time.Second)
-	for range ticker.C {
-		// 1. Query ZSET for tasks with Score <= Now
-		now := float64(time.Now().Unix())
-
-		// ZRangeByScore retrieves items that are "due"
-		results, err := rdb.ZRangeByScore(context.Background(), "retry_schedule", &redis.ZRangeBy{
-			Min: "-inf",
-			Max: fmt.Sprintf("%f", now),
-		}).Result()
-
-		if err != nil {
-			log.Printf("Poller Error: %v", err)
-			continue
-		}
-
-		if len(results) == 0 {
-			continue
-		}
-
-		// 2. Move them back to Main Queue
-		for _, member := range results {
-			fmt.Printf("⏰ Scheduler: Moving task back to queue: %s\n", member)
-
-			// Parse the JSON back to a Task
-			var task queue.Task
-			_ = json.Unmarshal([]byte(member), &task)
-
-			// Push to main queue
-			q.Enqueue(context.Background(), task)
-
-			// Remove from ZSET
-			rdb.ZRem(context.Background(), "retry_schedule", member)
-		}
+// pollOrder returns the queue names to poll, in priority order, for the
+// given mode. "weighted" reshuffles proportionally to queueWeights on
+// every call; anything else (including "strict") uses the fixed order.
+func pollOrder(mode string) []string {
+	if mode == "weighted" {
+		return queue.WeightedOrder(queueWeights)
 	}
+	return strictQueueOrder
 }
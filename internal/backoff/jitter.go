@@ -0,0 +1,66 @@
+package backoff
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"webhook-delivery/internal/queue"
+)
+
+// FullJitterStrategy picks a wait uniformly between 0 and the exponential
+// backoff cap for the current retry count, instead of returning that cap
+// deterministically. This spreads retries out so a downstream that just
+// recovered doesn't immediately get slammed by every worker waking up on
+// the same second.
+type FullJitterStrategy struct {
+	Base time.Duration // Starting wait time (e.g., 1s)
+	Max  time.Duration // Cap (e.g., max 1 hour)
+}
+
+func NewFullJitterStrategy(base time.Duration, max time.Duration) *FullJitterStrategy {
+	return &FullJitterStrategy{Base: base, Max: max}
+}
+
+func (s *FullJitterStrategy) GetNextInterval(task *queue.Task) time.Duration {
+	ceiling := time.Duration(math.Min(float64(s.Max), float64(s.Base)*math.Pow(2, float64(task.RetryCount))))
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// DecorrelatedJitterStrategy bases each wait on the previous one actually
+// chosen (task.LastBackoff) rather than a deterministic function of retry
+// count, which avoids the "every retry of every task lands in the same
+// handful of buckets" clustering that even full jitter can still produce.
+type DecorrelatedJitterStrategy struct {
+	Base time.Duration // Starting wait time, and the floor for every wait
+	Max  time.Duration // Cap (e.g., max 1 hour)
+}
+
+func NewDecorrelatedJitterStrategy(base time.Duration, max time.Duration) *DecorrelatedJitterStrategy {
+	return &DecorrelatedJitterStrategy{Base: base, Max: max}
+}
+
+// GetNextInterval returns min(Max, Base + rand[0, prev*3 - Base)), seeding
+// prev from Base on a task's first attempt, and writes the chosen wait back
+// onto task.LastBackoff so the next attempt starts from it.
+func (s *DecorrelatedJitterStrategy) GetNextInterval(task *queue.Task) time.Duration {
+	prev := task.LastBackoff
+	if prev <= 0 {
+		prev = s.Base
+	}
+
+	spread := int64(prev)*3 - int64(s.Base)
+	next := s.Base
+	if spread > 0 {
+		next = s.Base + time.Duration(rand.Int63n(spread))
+	}
+	if next > s.Max {
+		next = s.Max
+	}
+
+	task.LastBackoff = next
+	return next
+}
@@ -3,11 +3,17 @@ package backoff
 import (
 	"math"
 	"time"
+
+	"webhook-delivery/internal/queue"
 )
 
 // (Strategy Pattern)
+// GetNextInterval takes the task itself, not just its retry count, because
+// jittered strategies may need more than that: DecorrelatedJitterStrategy
+// reads (and writes back) task.LastBackoff to base the next wait on the
+// last one actually chosen, not a deterministic function of retry count.
 type Strategy interface {
-	GetNextInterval(retryCount int) time.Duration
+	GetNextInterval(task *queue.Task) time.Duration
 }
 
 // ExponentialStrategy implements the interface
@@ -26,9 +32,9 @@ func NewExponentialStrategy(base time.Duration, factor float64, max time.Duratio
 }
 
 // GetNextInterval calculates: Base * (Factor ^ RetryCount)
-func (s *ExponentialStrategy) GetNextInterval(retryCount int) time.Duration {
+func (s *ExponentialStrategy) GetNextInterval(task *queue.Task) time.Duration {
 	// Standard formula: 2^retry
-	multiplier := math.Pow(s.Factor, float64(retryCount))
+	multiplier := math.Pow(s.Factor, float64(task.RetryCount))
 	interval := time.Duration(float64(s.Base) * multiplier)
 
 	if interval > s.Max {
@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------- CIRCUIT BREAKER (per-hostname) ---------------------------------------------------------------
+
+// CircuitBreaker trips for a given hostname after too many consecutive
+// failures, so we stop hammering a downstream that's already down and let
+// its queued tasks fall straight back to the retry schedule until it has
+// had a chance to recover.
+type CircuitBreaker struct {
+	failThreshold int
+	cooldown      time.Duration
+
+	mu        sync.Mutex
+	failures  map[string]int
+	openUntil map[string]time.Time
+}
+
+// NewCircuitBreaker builds a breaker that trips after failThreshold
+// consecutive failures for a host and stays open for cooldown.
+func NewCircuitBreaker(failThreshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failThreshold: failThreshold,
+		cooldown:      cooldown,
+		failures:      make(map[string]int),
+		openUntil:     make(map[string]time.Time),
+	}
+}
+
+// Allow reports whether a delivery attempt to host should proceed. When
+// it returns false, resetAt is the time the breaker will let attempts
+// through again.
+func (b *CircuitBreaker) Allow(host string) (allowed bool, resetAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, open := b.openUntil[host]
+	if !open {
+		return true, time.Time{}
+	}
+	if time.Now().Before(until) {
+		return false, until
+	}
+
+	// Cooldown elapsed: close the breaker and reset the failure count. All
+	// attempts go through again; it only re-trips after another
+	// failThreshold consecutive failures.
+	delete(b.openUntil, host)
+	b.failures[host] = 0
+	return true, time.Time{}
+}
+
+// RecordSuccess resets the failure count for host, closing the breaker.
+func (b *CircuitBreaker) RecordSuccess(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[host] = 0
+	delete(b.openUntil, host)
+}
+
+// RecordFailure counts a failed attempt against host and trips the
+// breaker once it reaches failThreshold.
+func (b *CircuitBreaker) RecordFailure(host string) (resetAt time.Time, tripped bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures[host]++
+	if b.failures[host] < b.failThreshold {
+		return time.Time{}, false
+	}
+
+	resetAt = time.Now().Add(b.cooldown)
+	b.openUntil[host] = resetAt
+	return resetAt, true
+}
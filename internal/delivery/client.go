@@ -0,0 +1,170 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRedirects bounds how many redirects Deliver will follow. We supply
+// our own CheckRedirect (to re-validate every hop), which disables the
+// net/http default client's own redirect cap, so we enforce one ourselves.
+const maxRedirects = 10
+
+// --------------------------------------------------------------- HTTP DELIVERY ---------------------------------------------------------------
+
+// SignatureHeader carries the HMAC-SHA256 signature of the payload so a
+// subscriber can verify the delivery actually came from us.
+const SignatureHeader = "X-Webhook-Signature"
+
+// maxResponseBodyBytes caps how much of a subscriber's response we read.
+// Responses are kept around verbatim (eventually in the dead letter
+// entry), so an unbounded read lets a slow or malicious destination blow
+// up worker memory and Redis storage with an arbitrarily large body.
+const maxResponseBodyBytes = 64 * 1024
+
+// Result captures everything downstream logic (retry/dead-letter) needs
+// to decide what happens next to the task.
+type Result struct {
+	Success    bool
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+// Client performs the actual HTTP delivery of a webhook payload.
+type Client struct {
+	httpClient *http.Client
+	secret     string
+}
+
+// NewClient builds a delivery client with the given timeout. secret signs
+// every outgoing payload; an empty secret still produces a (useless but
+// harmless) signature rather than omitting the header.
+//
+// ValidateTargetURL at submission time only proves the hostname resolved to
+// a safe address at that moment - it can't stop a host that's repointed via
+// DNS between submission and an eventual (possibly much later, through
+// retries) delivery attempt, nor a destination that redirects us elsewhere
+// entirely. So the client re-checks on every real connection it makes: dial
+// re-resolves and re-validates the address actually being connected to, and
+// CheckRedirect re-validates every hop a redirect sends us to.
+func NewClient(timeout time.Duration, secret string) *Client {
+	c := &Client{secret: secret}
+	c.httpClient = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: c.safeDialContext,
+		},
+		CheckRedirect: checkRedirect,
+	}
+	return c
+}
+
+// safeDialContext resolves addr's host itself (rather than leaving it to
+// the default dialer) so it can reject any resolved address that isn't
+// safe to connect to - closing the gap where ValidateTargetURL's
+// submission-time check passes but the name is later repointed at an
+// internal address before we actually dial (DNS rebinding).
+func (c *Client) safeDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dial address %q: %w", addr, err)
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", host, err)
+	}
+
+	var dialer net.Dialer
+	var lastErr error
+	for _, ipAddr := range ips {
+		if isBlockedDestination(ipAddr.IP) {
+			lastErr = fmt.Errorf("refusing to dial %q: resolves to disallowed address %s", host, ipAddr.IP)
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ipAddr.IP.String(), port))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return conn, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for %q", host)
+	}
+	return nil, lastErr
+}
+
+// checkRedirect re-validates every redirect hop before following it, so a
+// destination can't use a 3xx response to send us somewhere
+// ValidateTargetURL would have rejected at submission time. The stdlib
+// default client stops after 10 redirects; setting our own CheckRedirect
+// disables that default, so we enforce the same cap ourselves.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if err := ValidateTargetURL(req.URL.String()); err != nil {
+		return fmt.Errorf("refusing to follow redirect: %w", err)
+	}
+	return nil
+}
+
+// Deliver POSTs payload to targetURL, signing it and attaching any
+// caller-supplied headers, and captures the response for the caller.
+func (c *Client) Deliver(ctx context.Context, targetURL, payload string, headers map[string]string) Result {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewBufferString(payload))
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to build request: %w", err)}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(SignatureHeader, c.sign(payload))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+
+	return Result{
+		Success:    resp.StatusCode >= 200 && resp.StatusCode < 300,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+	}
+}
+
+// sign computes the hex-encoded HMAC-SHA256 signature of payload.
+func (c *Client) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(c.secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Hostname extracts the destination host from a target URL so callers can
+// key per-host worker pools and circuit breakers off of it.
+func Hostname(targetURL string) (string, error) {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid target url: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("target url %q has no host", targetURL)
+	}
+	return u.Host, nil
+}
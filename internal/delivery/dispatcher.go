@@ -0,0 +1,145 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// --------------------------------------------------------------- PER-DESTINATION WORKER POOLS ---------------------------------------------------------------
+
+// poolSize bounds how many deliveries run concurrently per destination
+// host. A single slow or hanging subscriber then only ever occupies a
+// handful of goroutines, never the whole worker fleet.
+const poolSize = 3
+
+// poolQueueDepth bounds how many pending jobs we buffer per host before
+// Submit blocks; a worker briefly blocked handing off a job is far
+// cheaper than a worker goroutine stuck inside one slow HTTP call.
+const poolQueueDepth = 50
+
+// poolIdleTimeout is how long a host's pool can go without a Submit before
+// Run reclaims its goroutines. Webhook subscribers come and go with
+// whatever target_url a caller happened to send us, so a host that's
+// never delivered to again shouldn't cost us 3 goroutines forever.
+const poolIdleTimeout = 10 * time.Minute
+
+// hostPool is one destination host's goroutines plus the bookkeeping Run
+// needs to decide whether it's still worth keeping around.
+type hostPool struct {
+	jobs     chan func()
+	done     chan struct{}
+	lastUsed time.Time
+}
+
+// Dispatcher fans delivery jobs out across a small pool of goroutines per
+// destination hostname, gated by a CircuitBreaker.
+type Dispatcher struct {
+	breaker *CircuitBreaker
+
+	mu    sync.Mutex
+	pools map[string]*hostPool
+}
+
+// NewDispatcher builds a Dispatcher backed by the given breaker. Callers
+// should also start Run in its own goroutine to reclaim idle pools.
+func NewDispatcher(breaker *CircuitBreaker) *Dispatcher {
+	return &Dispatcher{
+		breaker: breaker,
+		pools:   make(map[string]*hostPool),
+	}
+}
+
+// Submit hands job off to host's pool. If the breaker for host is open,
+// job never runs; onBreakerOpen is called instead with the time the
+// breaker resets, so the caller can reschedule the task directly. Submit
+// reports whether the task was handled one way or the other: if ctx is
+// done before the pool has room (a backed-up host, or shutdown in
+// progress), it gives up and returns false instead of blocking the calling
+// consumer goroutine forever, leaving cleanup to the caller.
+func (d *Dispatcher) Submit(ctx context.Context, host string, job func(), onBreakerOpen func(resetAt time.Time)) bool {
+	if allowed, resetAt := d.breaker.Allow(host); !allowed {
+		onBreakerOpen(resetAt)
+		return true
+	}
+
+	select {
+	case d.poolFor(host).jobs <- job:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// poolFor returns the (lazily created) pool of goroutines for host,
+// touching its last-used time so Run won't evict it out from under us.
+func (d *Dispatcher) poolFor(host string) *hostPool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.pools[host]; ok {
+		p.lastUsed = time.Now()
+		return p
+	}
+
+	p := &hostPool{
+		jobs:     make(chan func(), poolQueueDepth),
+		done:     make(chan struct{}),
+		lastUsed: time.Now(),
+	}
+	d.pools[host] = p
+	for i := 0; i < poolSize; i++ {
+		go drain(p.jobs, p.done)
+	}
+	return p
+}
+
+// Run periodically reclaims pools for hosts that have gone quiet, until
+// ctx is canceled. It's driven the same way Scheduler.Run is: started as
+// its own goroutine alongside the rest of the worker's background jobs.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.evictIdle()
+		}
+	}
+}
+
+// evictIdle removes and tears down every pool that's had no Submit for
+// poolIdleTimeout and has nothing buffered. We never close jobs itself -
+// a Submit concurrently racing the sweep could be about to send on it, and
+// closing a channel out from under a pending send panics. Instead done is
+// closed to tell drain to stop; any old reference to jobs left over from
+// that narrow race just blocks until ctx.Done(), the same as a genuinely
+// backed-up pool.
+func (d *Dispatcher) evictIdle() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	for host, p := range d.pools {
+		if len(p.jobs) == 0 && now.Sub(p.lastUsed) > poolIdleTimeout {
+			close(p.done)
+			delete(d.pools, host)
+		}
+	}
+}
+
+// drain runs every job handed to a single pool worker until done is
+// closed, signaling the pool has been reclaimed as idle.
+func drain(jobs chan func(), done chan struct{}) {
+	for {
+		select {
+		case job := <-jobs:
+			job()
+		case <-done:
+			return
+		}
+	}
+}
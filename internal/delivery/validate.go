@@ -0,0 +1,48 @@
+package delivery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ValidateTargetURL rejects target URLs that would let a caller use us as
+// an open relay into internal network space: non-HTTP(S) schemes, and
+// hosts that resolve to loopback, link-local (including the cloud
+// metadata endpoint at 169.254.169.254), or other private addresses.
+func ValidateTargetURL(targetURL string) error {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("invalid target url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("target url scheme must be http or https, got %q", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("target url %q has no host", targetURL)
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve target host %q: %w", host, err)
+	}
+	for _, ip := range ips {
+		if isBlockedDestination(ip) {
+			return fmt.Errorf("target host %q resolves to a disallowed address %s", host, ip)
+		}
+	}
+	return nil
+}
+
+// isBlockedDestination reports whether ip falls in a range no external
+// webhook subscriber should ever live in: loopback, link-local, other
+// RFC1918/RFC4193 private space, or unspecified.
+func isBlockedDestination(ip net.IP) bool {
+	return ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified()
+}
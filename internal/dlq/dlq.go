@@ -0,0 +1,177 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"webhook-delivery/internal/queue"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------- DEAD LETTER QUEUE ---------------------------------------------------------------
+
+const (
+	setKey  = "dead_letter"
+	dataKey = "dead_letter_data"
+)
+
+// Entry is everything an operator needs to diagnose a permanently failed
+// task and decide whether to requeue or drop it.
+type Entry struct {
+	Task         queue.Task `json:"task"`
+	AttemptCount int        `json:"attempt_count"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastStatus   int        `json:"last_status,omitempty"`
+	LastBody     string     `json:"last_body,omitempty"`
+	FirstSeenAt  time.Time  `json:"first_seen_at"`
+	DeadAt       time.Time  `json:"dead_at"`
+}
+
+// Store is the Redis-backed dead letter queue: a ZSET of task IDs scored
+// by dead-at time (cheap oldest-first eviction and newest-first listing)
+// plus a hash holding the full Entry for each ID.
+type Store struct {
+	rdb     *redis.Client
+	maxSize int64
+}
+
+// NewStore builds a dead letter Store capped at maxSize entries; adding
+// past the cap evicts the oldest (by dead-at) entries first. maxSize <= 0
+// means unbounded.
+func NewStore(rdb *redis.Client, maxSize int64) *Store {
+	return &Store{rdb: rdb, maxSize: maxSize}
+}
+
+// Add archives entry, then evicts the oldest entries if the store grew
+// past its cap.
+func (s *Store) Add(ctx context.Context, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dlq entry: %w", err)
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.ZAdd(ctx, setKey, redis.Z{Score: float64(entry.DeadAt.Unix()), Member: entry.Task.ID})
+	pipe.HSet(ctx, dataKey, entry.Task.ID, data)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to archive dlq entry: %w", err)
+	}
+
+	return s.evictOverflow(ctx)
+}
+
+// evictOverflow drops the oldest entries once the store grows past maxSize.
+func (s *Store) evictOverflow(ctx context.Context) error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+
+	count, err := s.rdb.ZCard(ctx, setKey).Result()
+	if err != nil {
+		return err
+	}
+	overflow := count - s.maxSize
+	if overflow <= 0 {
+		return nil
+	}
+
+	ids, err := s.rdb.ZRange(ctx, setKey, 0, overflow-1).Result()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members := make([]interface{}, len(ids))
+	for i, id := range ids {
+		members[i] = id
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.ZRem(ctx, setKey, members...)
+	pipe.HDel(ctx, dataKey, ids...)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// List returns up to limit entries, newest-dead-at-first, starting after
+// cursor (an opaque string from a previous call's nextCursor; "" starts
+// from the newest). nextCursor is "" once there's nothing left to page.
+func (s *Store) List(ctx context.Context, limit int, cursor string) (entries []Entry, nextCursor string, err error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	offset, err := parseCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ids, err := s.rdb.ZRevRange(ctx, setKey, offset, offset+int64(limit)-1).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(ids) == 0 {
+		return nil, "", nil
+	}
+
+	raw, err := s.rdb.HMGet(ctx, dataKey, ids...).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, v := range raw {
+		str, ok := v.(string)
+		if !ok {
+			continue // entry expired/removed between ZRevRange and HMGet
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(str), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if int64(len(ids)) == int64(limit) {
+		nextCursor = strconv.FormatInt(offset+int64(limit), 10)
+	}
+	return entries, nextCursor, nil
+}
+
+func parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	offset, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return offset, nil
+}
+
+// Get fetches a single entry by task ID. It returns redis.Nil if no such
+// entry exists.
+func (s *Store) Get(ctx context.Context, id string) (Entry, error) {
+	data, err := s.rdb.HGet(ctx, dataKey, id).Result()
+	if err != nil {
+		return Entry{}, err
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return Entry{}, fmt.Errorf("failed to unmarshal dlq entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Delete permanently removes an entry.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	pipe := s.rdb.TxPipeline()
+	pipe.ZRem(ctx, setKey, id)
+	pipe.HDel(ctx, dataKey, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------- IDEMPOTENT ENQUEUE ---------------------------------------------------------------
+
+// ErrDuplicateTask is returned by UniqueEnqueue when the idempotency key
+// was already claimed by another task within its TTL.
+var ErrDuplicateTask = errors.New("duplicate task: idempotency key already in use")
+
+const idemKeyPrefix = "webhook:idem:"
+
+func idemKey(key string) string {
+	return idemKeyPrefix + key
+}
+
+// UniqueEnqueue claims key with SET NX EX before enqueueing task, so a
+// caller retrying the same logical request within ttl gets back the
+// original task's ID instead of a second delivery being queued.
+func (q *RedisQueue) UniqueEnqueue(ctx context.Context, qname string, task Task, key string, ttl time.Duration) (string, error) {
+	if key == "" {
+		// No idempotency key supplied: behave like a plain Enqueue.
+		if task.ID == "" {
+			task.ID = newTaskID()
+		}
+		if err := q.Enqueue(ctx, qname, task); err != nil {
+			return "", err
+		}
+		return task.ID, nil
+	}
+
+	if task.ID == "" {
+		task.ID = newTaskID()
+	}
+	task.IdempotencyKey = key
+
+	claimed, err := q.rdb.SetNX(ctx, idemKey(key), task.ID, ttl).Result()
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		existingID, err := q.rdb.Get(ctx, idemKey(key)).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return "", err
+		}
+		return existingID, ErrDuplicateTask
+	}
+
+	if err := q.Enqueue(ctx, qname, task); err != nil {
+		// Don't leave a lock behind for a task that never made it onto the queue.
+		_ = q.ReleaseIdempotencyKey(ctx, key)
+		return "", err
+	}
+	return task.ID, nil
+}
+
+// ReleaseIdempotencyKey frees the idempotency lock for key, if any was
+// set. It's safe to call on tasks that were never submitted with one.
+func (q *RedisQueue) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	if key == "" {
+		return nil
+	}
+	return q.rdb.Del(ctx, idemKey(key)).Err()
+}
@@ -0,0 +1,48 @@
+package queue
+
+import "math/rand"
+
+// --------------------------------------------------------------- WEIGHTED PRIORITY ORDERING ---------------------------------------------------------------
+
+// QueueWeight pairs a named queue with its integer weight for the
+// weighted-priority dequeue mode.
+type QueueWeight struct {
+	Name   string
+	Weight int
+}
+
+// WeightedOrder returns queue names ordered for a single Dequeue call.
+// Each queue is repeated proportionally to its weight and the result is
+// shuffled, so a higher-weight queue is more likely to land first without
+// ever fully starving a lower-weight one -- unlike a fixed strict order,
+// low gets picked first occasionally too.
+func WeightedOrder(weights []QueueWeight) []string {
+	var expanded []string
+	for _, w := range weights {
+		for i := 0; i < w.Weight; i++ {
+			expanded = append(expanded, w.Name)
+		}
+	}
+
+	rand.Shuffle(len(expanded), func(i, j int) {
+		expanded[i], expanded[j] = expanded[j], expanded[i]
+	})
+
+	return dedupeKeepFirst(expanded)
+}
+
+// dedupeKeepFirst collapses repeated names down to their first (i.e.
+// highest-priority, post-shuffle) occurrence. BRPOP only needs to see
+// each key once; its position in the list is what sets the priority.
+func dedupeKeepFirst(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	ordered := make([]string, 0, len(names))
+	for _, n := range names {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		ordered = append(ordered, n)
+	}
+	return ordered
+}
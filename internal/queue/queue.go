@@ -2,6 +2,8 @@ package queue
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -11,18 +13,112 @@ import (
 
 // --------------------------------------------------------------- ADAPTER PATTERN + "Dependency Inversion Principle" ---------------------------------------------------------------
 
+// Redis keys used by the queue and the retry/lease machinery around it.
+const (
+	QueueKeyPrefix   = "webhook_queue:"
+	RetryScheduleKey = "retry_schedule"
+	InFlightSetKey   = "in_flight"
+	InFlightDataKey  = "in_flight_data"
+)
+
+// DefaultQueueName is used whenever a task or caller doesn't specify one.
+const DefaultQueueName = "default"
+
+// The named queues workers actually poll (see cmd/worker/main.go's
+// queueWeights/strictQueueOrder, which are built from these same names).
+// Anything enqueued under a different name sits on a Redis list no
+// worker, retry poller, or lease-recovery job ever looks at, so callers
+// must be rejected before we accept a task onto one.
+const (
+	QueueCritical = "critical"
+	QueueDefault  = DefaultQueueName
+	QueueLow      = "low"
+)
+
+// KnownQueues lists every valid queue name, in no particular order.
+var KnownQueues = []string{QueueCritical, QueueDefault, QueueLow}
+
+// IsKnownQueue reports whether name is a queue workers actually poll. An
+// empty name is treated as DefaultQueueName, matching Enqueue/Dequeue.
+func IsKnownQueue(name string) bool {
+	if name == "" {
+		name = DefaultQueueName
+	}
+	for _, known := range KnownQueues {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// LeaseDuration is how long a worker has to finish (or heartbeat) a task
+// after dequeuing it before the recovery loop considers it abandoned.
+const LeaseDuration = 30 * time.Second
+
+// QueueKey returns the Redis list key backing the named queue.
+func QueueKey(name string) string {
+	if name == "" {
+		name = DefaultQueueName
+	}
+	return QueueKeyPrefix + name
+}
+
 // 1. The Data Structure (DTO)
 type Task struct {
-	Payload    string    `json:"payload"`
+	ID             string            `json:"id"`
+	UserID         string            `json:"user_id,omitempty"`
+	Queue          string            `json:"queue,omitempty"`
+	Payload        string            `json:"payload"`
+	TargetURL      string            `json:"target_url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	// Origin records how a task ended up back on the queue outside the
+	// normal flow, e.g. "dlq-requeue", so operators can trace manually
+	// replayed deliveries in logs.
+	Origin     string    `json:"origin,omitempty"`
 	RetryCount int       `json:"retry_count"`
 	CreatedAt  time.Time `json:"created_at"`
+	// LastBackoff is the wait the backoff strategy chose for the previous
+	// attempt. Jittered strategies that base the next wait on the last one
+	// actually taken (rather than a deterministic function of RetryCount)
+	// round-trip their state here across the retry schedule.
+	LastBackoff time.Duration `json:"last_backoff,omitempty"`
 }
 
 // 2. The Interface (Contract)
 // This is the "Dependency Inversion Principle".
 type Queue interface {
-	Enqueue(ctx context.Context, task Task) error
-	Dequeue(ctx context.Context) (*Task, error)
+	// Enqueue pushes task onto the named queue. An empty qname falls
+	// back to DefaultQueueName.
+	Enqueue(ctx context.Context, qname string, task Task) error
+	// Dequeue pops the next task off the first of qnames that has one
+	// (BRPOP checks them in the order given) and puts it on lease: it
+	// returns the time by which the worker must finish or renew, after
+	// which the recovery loop considers the task abandoned and moves it
+	// back onto its originating queue. No qnames falls back to
+	// DefaultQueueName.
+	//
+	// The pop and the lease record are two separate Redis calls, not one
+	// atomic step: a worker that crashes between them drops the task. That
+	// window is narrow (no network round trip or work happens in between)
+	// and Dequeue re-enqueues the task itself if the lease call comes back
+	// with an error, but it is not fully closed - only a single atomic
+	// pop-and-record (e.g. an RPOPLPUSH-style move) would close it outright.
+	Dequeue(ctx context.Context, qnames ...string) (*Task, time.Time, error)
+	// RenewLease extends the lease for a task currently being processed.
+	RenewLease(ctx context.Context, task *Task) (time.Time, error)
+	// ReleaseLease clears the in-flight lease, e.g. on success or once the
+	// task has been handed off to the retry schedule / dead letter queue.
+	ReleaseLease(ctx context.Context, task *Task) error
+	// UniqueEnqueue is Enqueue guarded by an idempotency key: if key was
+	// already used within ttl, it returns ErrDuplicateTask and the ID of
+	// the task that first claimed it instead of enqueueing a duplicate.
+	UniqueEnqueue(ctx context.Context, qname string, task Task, key string, ttl time.Duration) (string, error)
+	// ReleaseIdempotencyKey frees an idempotency lock once the task it
+	// guards reaches a terminal state, so a legitimate re-submission
+	// doesn't have to wait out the full ttl.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
 }
 
 // 3. The Implementation (Adapter Pattern)
@@ -38,11 +134,18 @@ func NewRedisQueue(rdb *redis.Client) Queue {
 }
 
 // Enqueue (Producer)
-func (q *RedisQueue) Enqueue(ctx context.Context, task Task) error {
+func (q *RedisQueue) Enqueue(ctx context.Context, qname string, task Task) error {
 	// Set default creation time if missing
 	if task.CreatedAt.IsZero() {
 		task.CreatedAt = time.Now()
 	}
+	if task.ID == "" {
+		task.ID = newTaskID()
+	}
+	if qname == "" {
+		qname = DefaultQueueName
+	}
+	task.Queue = qname
 
 	// Serialize: Convert Struct -> JSON String
 	data, err := json.Marshal(task)
@@ -52,26 +155,109 @@ func (q *RedisQueue) Enqueue(ctx context.Context, task Task) error {
 
 	// Push to Redis List
 	// LPush → Redis command to push an item to the head of a list
-	// "webhook_queue" → name of the Redis list
-	return q.rdb.LPush(ctx, "webhook_queue", data).Err()
+	return q.rdb.LPush(ctx, QueueKey(qname), data).Err()
 }
 
 // Dequeue (Consumer)
-func (q *RedisQueue) Dequeue(ctx context.Context) (*Task, error) {
+func (q *RedisQueue) Dequeue(ctx context.Context, qnames ...string) (*Task, time.Time, error) {
+	if len(qnames) == 0 {
+		qnames = []string{DefaultQueueName}
+	}
+	keys := make([]string, len(qnames))
+	for i, name := range qnames {
+		keys[i] = QueueKey(name)
+	}
+
 	// BRPop → Redis command to pop an item from the tail of a list
 	// 0 → block indefinitely if the list is empty (wait until a task arrives)
-	// "webhook_queue" → name of the list
-	result, err := q.rdb.BRPop(ctx, 0, "webhook_queue").Result()
+	// Checks the given keys in order, so earlier queues get priority.
+	result, err := q.rdb.BRPop(ctx, 0, keys...).Result()
 	if err != nil {
-		return nil, err
+		return nil, time.Time{}, err
 	}
 
 	// result[1] is the JSON string
 	var task Task
-	err = json.Unmarshal([]byte(result[1]), &task)
+	if err := json.Unmarshal([]byte(result[1]), &task); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to unmarshal task: %w", err)
+	}
+	if task.ID == "" {
+		task.ID = newTaskID()
+	}
+
+	lease, err := q.acquireLease(ctx, &task)
+	if err != nil {
+		// The task is already off its queue; if we can't record it as
+		// in-flight, put it back rather than silently losing it. This
+		// covers a transient error on the lease call itself - it can't
+		// cover a worker crashing between BRPop and here, which is an
+		// inherent gap in a two-step (not atomic) hand-off.
+		if requeueErr := q.rdb.LPush(ctx, QueueKey(task.Queue), result[1]).Err(); requeueErr != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to acquire lease (%w) and failed to requeue task %s (%v): task may be lost", err, task.ID, requeueErr)
+		}
+		return nil, time.Time{}, fmt.Errorf("failed to acquire lease, requeued task %s: %w", task.ID, err)
+	}
+
+	return &task, lease, nil
+}
+
+// acquireLease records the popped task as "in flight": a ZSET entry scored
+// by lease expiry, plus the serialized task so the recovery loop can put it
+// back on the main queue if the worker never finishes it. It runs as a
+// separate Redis call from the pop in Dequeue, not atomically with it -
+// see Dequeue's doc comment.
+func (q *RedisQueue) acquireLease(ctx context.Context, task *Task) (time.Time, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expiry := time.Now().Add(LeaseDuration)
+
+	pipe := q.rdb.TxPipeline()
+	pipe.ZAdd(ctx, InFlightSetKey, redis.Z{Score: float64(expiry.Unix()), Member: task.ID})
+	pipe.HSet(ctx, InFlightDataKey, task.ID, data)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return time.Time{}, err
+	}
+
+	return expiry, nil
+}
+
+// RenewLease heartbeats an in-progress task so the recovery loop doesn't
+// treat a slow-but-alive worker as crashed.
+func (q *RedisQueue) RenewLease(ctx context.Context, task *Task) (time.Time, error) {
+	expiry := time.Now().Add(LeaseDuration)
+	err := q.rdb.ZAddArgs(ctx, InFlightSetKey, redis.ZAddArgs{
+		GT: true,
+		Members: []redis.Z{
+			{Score: float64(expiry.Unix()), Member: task.ID},
+		},
+	}).Err()
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal task: %w", err)
+		return time.Time{}, err
 	}
+	return expiry, nil
+}
 
-	return &task, nil
+// ReleaseLease removes the in-flight bookkeeping for a task once it has
+// reached a terminal state for this attempt (delivered, scheduled for
+// retry, or dead-lettered).
+func (q *RedisQueue) ReleaseLease(ctx context.Context, task *Task) error {
+	pipe := q.rdb.TxPipeline()
+	pipe.ZRem(ctx, InFlightSetKey, task.ID)
+	pipe.HDel(ctx, InFlightDataKey, task.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// newTaskID generates a short random identifier for a task. We avoid a
+// full UUID dependency since we only need something unique enough to key
+// the in-flight lease and (later) the dead letter entries.
+func newTaskID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("t%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
 }
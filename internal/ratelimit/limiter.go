@@ -12,10 +12,21 @@ import (
 
 var ErrRateLimitExceeded = errors.New("rate limit exceeded")
 
+// Decision reports the outcome of a rate limit check along with enough
+// bookkeeping for the caller to surface standard X-RateLimit-* / Retry-After
+// headers. Limit and Remaining are -1 for limiters that don't enforce a cap
+// (e.g. NoOpLimiter), telling the caller to skip those headers entirely.
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
 // The Strategy Interface
-// This defines the "Contract". Any algorithm (Fixed Window, Token Bucket, Leaky Bucket)
+// This defines the "Contract". Any algorithm (Fixed Window, Sliding Window, Token Bucket, ...)
 type Limiter interface {
-	Allow(ctx context.Context, userID string) (bool, error)
+	Allow(ctx context.Context, userID string) (Decision, error)
 }
 
 // ----> Concrete Strategy A: Fixed Window
@@ -37,13 +48,13 @@ func NewFixedWindowLimiter(rdb *redis.Client, limit int, window time.Duration) L
 	}
 }
 
-func (l *FixedWindowLimiter) Allow(ctx context.Context, userID string) (bool, error) {
+func (l *FixedWindowLimiter) Allow(ctx context.Context, userID string) (Decision, error) {
 	key := "rate_limit:" + userID
 
 	// Increment
 	count, err := l.rdb.Incr(ctx, key).Result()
 	if err != nil {
-		return false, err
+		return Decision{}, err
 	}
 
 	// Set expiry only on the first request
@@ -51,11 +62,20 @@ func (l *FixedWindowLimiter) Allow(ctx context.Context, userID string) (bool, er
 		l.rdb.Expire(ctx, key, l.window)
 	}
 
+	remaining := l.limit - int(count)
+	if remaining < 0 {
+		remaining = 0
+	}
+
 	// Check Limit
 	if count > int64(l.limit) {
-		return false, nil
+		ttl, err := l.rdb.TTL(ctx, key).Result()
+		if err != nil || ttl < 0 {
+			ttl = l.window
+		}
+		return Decision{Allowed: false, Limit: l.limit, Remaining: 0, RetryAfter: ttl}, nil
 	}
-	return true, nil
+	return Decision{Allowed: true, Limit: l.limit, Remaining: remaining}, nil
 }
 
 // ----> Concrete Strategy B: No-Op (Null Object Pattern)
@@ -66,7 +86,7 @@ func NewNoOpLimiter() Limiter {
 	return &NoOpLimiter{}
 }
 
-func (l *NoOpLimiter) Allow(ctx context.Context, userID string) (bool, error) {
-	// Always allow, never error
-	return true, nil
+func (l *NoOpLimiter) Allow(ctx context.Context, userID string) (Decision, error) {
+	// Always allow, never error, and no cap to report.
+	return Decision{Allowed: true, Limit: -1, Remaining: -1}, nil
 }
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ----> Concrete Strategy C: Sliding Window
+// Tracks each request's timestamp in a per-user ZSET instead of a single
+// counter, so the limit applies to any rolling window rather than resetting
+// in a burst-friendly lump at fixed boundaries.
+type SlidingWindowLimiter struct {
+	rdb    *redis.Client
+	limit  int
+	window time.Duration
+}
+
+func NewSlidingWindowLimiter(rdb *redis.Client, limit int, window time.Duration) Limiter {
+	return &SlidingWindowLimiter{rdb: rdb, limit: limit, window: window}
+}
+
+// slidingWindowScript atomically: drops timestamps older than the window,
+// counts what's left, and - if under limit - records this request. The
+// score (ARGV[1], the request's arrival time in nanoseconds) is re-used as
+// the member itself, which is unique enough in practice to avoid collisions
+// between requests from the same user.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local windowMs = tonumber(ARGV[4])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+
+if count < limit then
+	redis.call('ZADD', key, now, tostring(now))
+	redis.call('PEXPIRE', key, windowMs)
+	return {1, count + 1}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+return {0, count, oldest[2]}
+`)
+
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, userID string) (Decision, error) {
+	key := "rate_limit:sliding:" + userID
+	nowNs := time.Now().UnixNano()
+	windowNs := l.window.Nanoseconds()
+	windowMs := windowNs / int64(time.Millisecond)
+
+	res, err := slidingWindowScript.Run(ctx, l.rdb, []string{key}, nowNs, windowNs, l.limit, windowMs).Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	allowed := res[0].(int64) == 1
+	if allowed {
+		used := res[1].(int64)
+		remaining := l.limit - int(used)
+		if remaining < 0 {
+			remaining = 0
+		}
+		return Decision{Allowed: true, Limit: l.limit, Remaining: remaining}, nil
+	}
+
+	retryAfter := l.window
+	if len(res) > 2 {
+		if oldestStr, ok := res[2].(string); ok {
+			if oldestNs, err := strconv.ParseInt(oldestStr, 10, 64); err == nil {
+				retryAfter = time.Duration(oldestNs+windowNs-nowNs) * time.Nanosecond
+				if retryAfter < 0 {
+					retryAfter = 0
+				}
+			}
+		}
+	}
+	return Decision{Allowed: false, Limit: l.limit, Remaining: 0, RetryAfter: retryAfter}, nil
+}
@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ----> Concrete Strategy D: Token Bucket
+// Smooths bursts by letting a user spend saved-up tokens quickly, as long
+// as their average rate over time stays under `rate` tokens/sec, up to a
+// `burst` ceiling.
+type TokenBucketLimiter struct {
+	rdb   *redis.Client
+	rate  float64 // tokens refilled per second
+	burst int     // bucket capacity
+}
+
+func NewTokenBucketLimiter(rdb *redis.Client, rate float64, burst int) Limiter {
+	return &TokenBucketLimiter{rdb: rdb, rate: rate, burst: burst}
+}
+
+// tokenBucketScript atomically refills the bucket for elapsed time, then
+// spends one token if available. The hash is left with an EXPIRE long
+// enough for the bucket to fully refill before we'd need its history again.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local bucket = redis.call('HMGET', key, 'tokens', 'last_refill_ms')
+local tokens = tonumber(bucket[1])
+local lastRefill = tonumber(bucket[2])
+if tokens == nil then
+	tokens = burst
+	lastRefill = now
+end
+
+local elapsed = now - lastRefill
+if elapsed > 0 then
+	tokens = math.min(burst, tokens + elapsed * rate / 1000)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	allowed = 1
+	tokens = tokens - 1
+end
+
+redis.call('HSET', key, 'tokens', tokens, 'last_refill_ms', now)
+redis.call('PEXPIRE', key, ttl)
+
+return {allowed, tostring(tokens)}
+`)
+
+func (l *TokenBucketLimiter) Allow(ctx context.Context, userID string) (Decision, error) {
+	key := "rate_limit:token_bucket:" + userID
+	nowMs := time.Now().UnixMilli()
+	// A bucket that's gone untouched for this long has fully refilled, so
+	// there's nothing worth remembering past this point.
+	ttlMs := int64(float64(l.burst) / l.rate * 1000)
+
+	res, err := tokenBucketScript.Run(ctx, l.rdb, []string{key}, nowMs, l.rate, l.burst, ttlMs).Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+
+	allowed := res[0].(int64) == 1
+	tokens, _ := strconv.ParseFloat(res[1].(string), 64)
+	remaining := int(tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if allowed {
+		return Decision{Allowed: true, Limit: l.burst, Remaining: remaining}, nil
+	}
+
+	missing := 1 - tokens
+	retryAfter := time.Duration(missing/l.rate*1000) * time.Millisecond
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return Decision{Allowed: false, Limit: l.burst, Remaining: 0, RetryAfter: retryAfter}, nil
+}
@@ -0,0 +1,160 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"webhook-delivery/internal/queue"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// --------------------------------------------------------------- SCHEDULER ---------------------------------------------------------------
+//
+// Scheduler owns two background jobs that move tasks back onto the main
+// queue: the retry poller (tasks scheduled for a future retry) and the
+// lease recovery loop (tasks a worker picked up but never finished). Both
+// do their "check-and-enqueue" in a single Lua script so a check and the
+// move it triggers can never be split across two workers polling at once.
+
+// maxBatchSize bounds how many entries a single tick can move, so the Lua
+// script never runs unbounded against Redis even if a large backlog piles up.
+const maxBatchSize = 100
+
+// retryScript atomically finds due retries, pushes each back onto its
+// originating named queue, and removes them from the schedule. The queue
+// name travels with the task itself (the "queue" field of its JSON), so
+// the script decodes it to pick the destination list.
+//
+// KEYS[1] = retry schedule ZSET
+// ARGV[1] = now (unix seconds)
+// ARGV[2] = batch size
+// ARGV[3] = default queue name
+// ARGV[4] = queue key prefix
+var retryScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, member in ipairs(due) do
+	local task = cjson.decode(member)
+	local qname = task.queue
+	if qname == nil or qname == '' then
+		qname = ARGV[3]
+	end
+	redis.call('LPUSH', ARGV[4] .. qname, member)
+	redis.call('ZREM', KEYS[1], member)
+end
+return #due
+`)
+
+// recoverScript atomically finds expired leases, pushes the corresponding
+// task back onto its originating named queue, and clears the in-flight
+// bookkeeping.
+//
+// KEYS[1] = in-flight ZSET (task id -> lease expiry)
+// KEYS[2] = in-flight data hash (task id -> task JSON)
+// ARGV[1] = now (unix seconds)
+// ARGV[2] = batch size
+// ARGV[3] = default queue name
+// ARGV[4] = queue key prefix
+var recoverScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+local recovered = 0
+for _, id in ipairs(expired) do
+	local data = redis.call('HGET', KEYS[2], id)
+	if data then
+		local task = cjson.decode(data)
+		local qname = task.queue
+		if qname == nil or qname == '' then
+			qname = ARGV[3]
+		end
+		redis.call('LPUSH', ARGV[4] .. qname, data)
+		redis.call('HDEL', KEYS[2], id)
+		recovered = recovered + 1
+	end
+	redis.call('ZREM', KEYS[1], id)
+end
+return recovered
+`)
+
+// Scheduler runs the retry poller and lease recovery loop.
+type Scheduler struct {
+	rdb *redis.Client
+}
+
+// New builds a Scheduler bound to the given Redis client.
+func New(rdb *redis.Client) *Scheduler {
+	return &Scheduler{rdb: rdb}
+}
+
+// PollRetries moves due retries back onto their originating named queue
+// in one atomic step and returns how many it moved.
+func (s *Scheduler) PollRetries(ctx context.Context) (int, error) {
+	now := fmt.Sprintf("%d", time.Now().Unix())
+	result, err := retryScript.Run(ctx, s.rdb, []string{queue.RetryScheduleKey},
+		now, maxBatchSize, queue.DefaultQueueName, queue.QueueKeyPrefix).Int()
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// RecoverExpiredLeases moves tasks whose lease expired (the worker that
+// dequeued them crashed or hung) back onto their originating named queue.
+func (s *Scheduler) RecoverExpiredLeases(ctx context.Context) (int, error) {
+	now := fmt.Sprintf("%d", time.Now().Unix())
+	result, err := recoverScript.Run(ctx, s.rdb, []string{queue.InFlightSetKey, queue.InFlightDataKey},
+		now, maxBatchSize, queue.DefaultQueueName, queue.QueueKeyPrefix).Int()
+	if err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// Run polls both jobs on the given interval until ctx is canceled. On
+// shutdown it drains any remaining due retries and expired leases so
+// nothing is left stranded in the ZSETs between the last tick and exit.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(context.Background())
+			return
+		case <-ticker.C:
+			if n, err := s.PollRetries(ctx); err != nil {
+				log.Printf("Scheduler: retry poll error: %v", err)
+			} else if n > 0 {
+				fmt.Printf("⏰ Scheduler: moved %d retry task(s) back to queue\n", n)
+			}
+
+			if n, err := s.RecoverExpiredLeases(ctx); err != nil {
+				log.Printf("Scheduler: lease recovery error: %v", err)
+			} else if n > 0 {
+				fmt.Printf("🔁 Scheduler: recovered %d task(s) with expired leases\n", n)
+			}
+		}
+	}
+}
+
+// drain repeatedly polls both jobs until a tick moves nothing, so shutdown
+// doesn't leave due work sitting in Redis until the next process starts.
+func (s *Scheduler) drain(ctx context.Context) {
+	for {
+		retries, err := s.PollRetries(ctx)
+		if err != nil {
+			log.Printf("Scheduler: drain retry poll error: %v", err)
+			return
+		}
+		recovered, err := s.RecoverExpiredLeases(ctx)
+		if err != nil {
+			log.Printf("Scheduler: drain lease recovery error: %v", err)
+			return
+		}
+		if retries == 0 && recovered == 0 {
+			return
+		}
+	}
+}
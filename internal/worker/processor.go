@@ -5,61 +5,164 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
 	"time"
 
 	"webhook-delivery/internal/backoff"
+	"webhook-delivery/internal/delivery"
+	"webhook-delivery/internal/dlq"
 	"webhook-delivery/internal/queue"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// maxRetries is how many retries a task gets after its first attempt; when
+// attempt maxRetries+1 fails too, the task is archived to the dead letter
+// queue instead of being rescheduled again.
+const maxRetries = 5
+
 // Processor handles the lifecycle of a task
 type Processor struct {
-	rdb     *redis.Client
-	queue   queue.Queue
-	backoff backoff.Strategy
+	rdb        *redis.Client
+	queue      queue.Queue
+	backoff    backoff.Strategy
+	client     *delivery.Client
+	breaker    *delivery.CircuitBreaker
+	dispatcher *delivery.Dispatcher
+	deadLetter *dlq.Store
 }
 
-func NewProcessor(rdb *redis.Client, q queue.Queue, b backoff.Strategy) *Processor {
+func NewProcessor(rdb *redis.Client, q queue.Queue, b backoff.Strategy, client *delivery.Client, breaker *delivery.CircuitBreaker, dispatcher *delivery.Dispatcher, deadLetter *dlq.Store) *Processor {
 	return &Processor{
-		rdb:     rdb,
-		queue:   q,
-		backoff: b,
+		rdb:        rdb,
+		queue:      q,
+		backoff:    b,
+		client:     client,
+		breaker:    breaker,
+		dispatcher: dispatcher,
+		deadLetter: deadLetter,
 	}
 }
 
+// Process hands the task off to its destination's delivery pool. It
+// returns as soon as the hand-off is done (or the breaker redirects the
+// task straight back to the retry schedule) so the caller is free to go
+// dequeue the next task instead of blocking on a possibly-slow subscriber.
 func (p *Processor) Process(ctx context.Context, task *queue.Task) {
-	fmt.Printf("🔄 Processing Task: %s (Attempt %d)\n", task.Payload, task.RetryCount+1)
+	host, err := delivery.Hostname(task.TargetURL)
+	if err != nil {
+		log.Printf("Task %s has an invalid target_url %q: %v", task.ID, task.TargetURL, err)
+		p.handleFailure(ctx, task, delivery.Result{Err: err})
+		return
+	}
 
-	// 1. Simulate HTTP Request (The "Job")
-	success := p.simulateWebhookCall(task.Payload)
+	// Heartbeat the lease until the job (running in the host's pool,
+	// possibly well after Process returns) finishes with it.
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go p.heartbeatLease(heartbeatCtx, task)
 
-	if success {
-		fmt.Printf("✅ Success: %s\n", task.Payload)
-		return // Done! Task is already removed from queue by Dequeue
+	job := func() {
+		defer stopHeartbeat()
+		p.deliver(ctx, task, host)
 	}
 
-	// 2. Handle Failure
-	p.handleFailure(ctx, task)
+	handled := p.dispatcher.Submit(ctx, host, job, func(resetAt time.Time) {
+		stopHeartbeat()
+		fmt.Printf("⚡ Circuit open for %s, rescheduling task %s for %s\n", host, task.ID, resetAt.Format(time.RFC3339))
+		p.rescheduleAt(ctx, task, resetAt)
+		if err := p.queue.ReleaseLease(ctx, task); err != nil {
+			log.Printf("Error releasing lease for %s: %v", task.ID, err)
+		}
+	})
+	if !handled {
+		// ctx was done before host's pool had room: most likely shutdown in
+		// progress, or the pool genuinely backed up. Either way we must not
+		// block this consumer goroutine waiting for space. The lease is
+		// left in place; the recovery loop will pick the task back up once
+		// it expires.
+		stopHeartbeat()
+		log.Printf("Task %s not dispatched to %s before context was done; leaving it for lease recovery", task.ID, host)
+	}
 }
 
-func (p *Processor) simulateWebhookCall(payload string) bool {
-	// Simulate 50% chance of failure
-	time.Sleep(500 * time.Millisecond) // Network latency
-	return rand.Intn(2) == 1
+// deliver performs the actual HTTP call and decides success/failure. It
+// runs inside one of the destination host's pool goroutines.
+func (p *Processor) deliver(ctx context.Context, task *queue.Task, host string) {
+	fmt.Printf("🔄 Delivering Task: %s -> %s (Attempt %d)\n", task.ID, task.TargetURL, task.RetryCount+1)
+
+	result := p.client.Deliver(ctx, task.TargetURL, task.Payload, task.Headers)
+
+	if result.Success {
+		fmt.Printf("✅ Success: %s (status %d)\n", task.ID, result.StatusCode)
+		p.breaker.RecordSuccess(host)
+		if err := p.queue.ReleaseLease(ctx, task); err != nil {
+			log.Printf("Error releasing lease for %s: %v", task.ID, err)
+		}
+		if err := p.queue.ReleaseIdempotencyKey(ctx, task.IdempotencyKey); err != nil {
+			log.Printf("Error releasing idempotency key for %s: %v", task.ID, err)
+		}
+		return
+	}
+
+	if result.Err != nil {
+		log.Printf("Delivery error for task %s: %v", task.ID, result.Err)
+	} else {
+		log.Printf("Delivery for task %s rejected by %s with status %d", task.ID, host, result.StatusCode)
+	}
+
+	if resetAt, tripped := p.breaker.RecordFailure(host); tripped {
+		fmt.Printf("⚡ Circuit breaker tripped for %s until %s\n", host, resetAt.Format(time.RFC3339))
+	}
+
+	p.handleFailure(ctx, task, result)
+}
+
+// heartbeatLease periodically renews the in-flight lease for a task until
+// it's done with (success, retry scheduling, or dead letter).
+func (p *Processor) heartbeatLease(ctx context.Context, task *queue.Task) {
+	ticker := time.NewTicker(queue.LeaseDuration / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.queue.RenewLease(ctx, task); err != nil {
+				log.Printf("Error renewing lease for %s: %v", task.ID, err)
+			}
+		}
+	}
 }
 
-func (p *Processor) handleFailure(ctx context.Context, task *queue.Task) {
+func (p *Processor) handleFailure(ctx context.Context, task *queue.Task, result delivery.Result) {
 	// A. Check Max Retries (Circuit Breaker logic)
-	if task.RetryCount >= 5 {
+	if task.RetryCount >= maxRetries {
 		fmt.Printf("💀 Dead Letter: Task failed too many times. Dropping %s\n", task.Payload)
-		// TODO: In a real app, push this to a "dead_letter_queue" list for manual inspection
+		entry := dlq.Entry{
+			Task:         *task,
+			AttemptCount: task.RetryCount + 1,
+			LastStatus:   result.StatusCode,
+			LastBody:     result.Body,
+			FirstSeenAt:  task.CreatedAt,
+			DeadAt:       time.Now(),
+		}
+		if result.Err != nil {
+			entry.LastError = result.Err.Error()
+		}
+		if err := p.deadLetter.Add(ctx, entry); err != nil {
+			log.Printf("Error archiving task %s to dead letter queue: %v", task.ID, err)
+		}
+		if err := p.queue.ReleaseLease(ctx, task); err != nil {
+			log.Printf("Error releasing lease for %s: %v", task.ID, err)
+		}
+		if err := p.queue.ReleaseIdempotencyKey(ctx, task.IdempotencyKey); err != nil {
+			log.Printf("Error releasing idempotency key for %s: %v", task.ID, err)
+		}
 		return
 	}
 
 	// B. Calculate Wait Time
-	waitDuration := p.backoff.GetNextInterval(task.RetryCount)
+	waitDuration := p.backoff.GetNextInterval(task)
 	task.RetryCount++ // Increment counter
 
 	fmt.Printf("⚠️ Failed. Retrying in %v (Attempt %d)\n", waitDuration, task.RetryCount+1)
@@ -68,13 +171,22 @@ func (p *Processor) handleFailure(ctx context.Context, task *queue.Task) {
 	// We cannot use the main queue because that's for "Now".
 	// We use a Redis "ZSET" (Sorted Set) where Score = Execution Timestamp.
 	p.scheduleRetry(ctx, task, waitDuration)
+
+	// The task now lives in the retry schedule, not in flight anymore.
+	if err := p.queue.ReleaseLease(ctx, task); err != nil {
+		log.Printf("Error releasing lease for %s: %v", task.ID, err)
+	}
 }
 
 func (p *Processor) scheduleRetry(ctx context.Context, task *queue.Task, delay time.Duration) {
-	// We need to re-serialize the task to store it
-	// (Skipping error handling for brevity, but critical in prod)
-	// In real app: create a queue.Serialize(task) helper
+	p.rescheduleAt(ctx, task, time.Now().Add(delay))
+}
 
+// rescheduleAt pushes task onto the retry schedule to run at executeAt.
+// Used both for a normal failed-attempt backoff and for a breaker-open
+// short-circuit, where we skip the attempt entirely and just wait for the
+// breaker's own cooldown.
+func (p *Processor) rescheduleAt(ctx context.Context, task *queue.Task, executeAt time.Time) {
 	// We marshal the WHOLE task struct, so we keep the payload AND the retry_count
 	data, err := json.Marshal(task)
 	if err != nil {
@@ -82,13 +194,10 @@ func (p *Processor) scheduleRetry(ctx context.Context, task *queue.Task, delay t
 		return
 	}
 
-	// Score = Now + Delay
-	executeAt := time.Now().Add(delay).Unix()
-
 	// Add to ZSET
-	// Member is now the valid JSON string: {"payload":"Payment 500","retry_count":1}
-	err = p.rdb.ZAdd(ctx, "retry_schedule", redis.Z{
-		Score:  float64(executeAt),
+	// Member is now the valid JSON string: {"id":"...","payload":"Payment 500","retry_count":1}
+	err = p.rdb.ZAdd(ctx, queue.RetryScheduleKey, redis.Z{
+		Score:  float64(executeAt.Unix()),
 		Member: data, // Pass the byte slice directly (go-redis handles it)
 	}).Err()
 